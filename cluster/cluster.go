@@ -0,0 +1,208 @@
+// Package cluster lets multiple dhammer instances coordinate a shared target
+// rate by registering themselves with a pluggable discovery backend and
+// dividing the configured rate across the peers currently known to be
+// healthy.
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Peer describes one dhammer instance participating in a cluster.
+type Peer struct {
+	ID            string `json:"id"`
+	APIAddr       string `json:"api_addr"`
+	HammerType    string `json:"hammer_type"`
+	AdvertisedRPS int    `json:"advertised_rps"`
+}
+
+// Discovery is the pluggable backend used to register this instance and
+// watch for peers joining/leaving. Consul, etcd, and a fixed/static list are
+// all just implementations of this interface.
+type Discovery interface {
+	Register(p Peer) error
+	Deregister(id string) error
+	Watch() (<-chan []Peer, error)
+}
+
+// StaticDiscovery implements Discovery over a fixed, in-memory peer list.
+// It's useful for small clusters or tests where running Consul/etcd would be
+// overkill.
+type StaticDiscovery struct {
+	mu       sync.Mutex
+	peers    map[string]Peer
+	watchers []chan []Peer
+}
+
+func NewStaticDiscovery() *StaticDiscovery {
+	return &StaticDiscovery{
+		peers: make(map[string]Peer),
+	}
+}
+
+func (d *StaticDiscovery) Register(p Peer) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.peers[p.ID] = p
+	d.notifyLocked()
+
+	return nil
+}
+
+func (d *StaticDiscovery) Deregister(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.peers, id)
+	d.notifyLocked()
+
+	return nil
+}
+
+func (d *StaticDiscovery) Watch() (<-chan []Peer, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ch := make(chan []Peer, 1)
+	d.watchers = append(d.watchers, ch)
+	ch <- d.snapshotLocked()
+
+	return ch, nil
+}
+
+func (d *StaticDiscovery) notifyLocked() {
+	snapshot := d.snapshotLocked()
+
+	for _, ch := range d.watchers {
+		select {
+		case ch <- snapshot:
+		default:
+		}
+	}
+}
+
+func (d *StaticDiscovery) snapshotLocked() []Peer {
+	peers := make([]Peer, 0, len(d.peers))
+	for _, p := range d.peers {
+		peers = append(peers, p)
+	}
+
+	return peers
+}
+
+// Client registers self with a Discovery backend, heartbeats on an interval,
+// and invokes onPeersChanged whenever the set of known peers changes.
+type Client struct {
+	self           Peer
+	discovery      Discovery
+	heartbeat      time.Duration
+	onPeersChanged func([]Peer)
+
+	mu    sync.RWMutex
+	peers []Peer
+
+	stopCh chan struct{}
+}
+
+func NewClient(self Peer, discovery Discovery, heartbeat time.Duration, onPeersChanged func([]Peer)) *Client {
+	return &Client{
+		self:           self,
+		discovery:      discovery,
+		heartbeat:      heartbeat,
+		onPeersChanged: onPeersChanged,
+		stopCh:         make(chan struct{}),
+	}
+}
+
+// Start registers self with the discovery backend and begins heartbeating
+// and watching for peer changes. It returns once the initial registration
+// and watch succeed; both run in background goroutines afterward.
+func (c *Client) Start() error {
+	if err := c.discovery.Register(c.self); err != nil {
+		return err
+	}
+
+	peerCh, err := c.discovery.Watch()
+	if err != nil {
+		if deregisterErr := c.discovery.Deregister(c.self.ID); deregisterErr != nil {
+			return fmt.Errorf("%w (and deregister failed: %s)", err, deregisterErr)
+		}
+
+		return err
+	}
+
+	go func() {
+		for {
+			select {
+			case peers, ok := <-peerCh:
+				if !ok {
+					return
+				}
+				c.mu.Lock()
+				c.peers = peers
+				c.mu.Unlock()
+
+				if c.onPeersChanged != nil {
+					c.onPeersChanged(peers)
+				}
+			case <-c.stopCh:
+				return
+			}
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(c.heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.discovery.Register(c.self)
+			case <-c.stopCh:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop deregisters self and stops the heartbeat/watch goroutines.
+func (c *Client) Stop() error {
+	close(c.stopCh)
+
+	return c.discovery.Deregister(c.self.ID)
+}
+
+// Peers returns the most recently observed set of healthy peers.
+func (c *Client) Peers() []Peer {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	peers := make([]Peer, len(c.peers))
+	copy(peers, c.peers)
+
+	return peers
+}
+
+// ErrNoHealthyPeers is returned when a rate needs to be divided across zero
+// known peers.
+var ErrNoHealthyPeers = errors.New("cluster: no healthy peers")
+
+// SharedRPS divides configRPS evenly across the currently known peers,
+// including self. It returns ErrNoHealthyPeers if no peers (not even self)
+// are known yet.
+func (c *Client) SharedRPS(configRPS int) (int, error) {
+	peers := c.Peers()
+
+	if len(peers) == 0 {
+		return 0, ErrNoHealthyPeers
+	}
+
+	return configRPS / len(peers), nil
+}
@@ -0,0 +1,123 @@
+package cluster
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// watchFailingDiscovery registers normally but always fails to Watch, so
+// tests can exercise Client.Start's cleanup path.
+type watchFailingDiscovery struct {
+	registered   []string
+	deregistered []string
+}
+
+func (d *watchFailingDiscovery) Register(p Peer) error {
+	d.registered = append(d.registered, p.ID)
+	return nil
+}
+
+func (d *watchFailingDiscovery) Deregister(id string) error {
+	d.deregistered = append(d.deregistered, id)
+	return nil
+}
+
+func (d *watchFailingDiscovery) Watch() (<-chan []Peer, error) {
+	return nil, errors.New("watch unavailable")
+}
+
+func TestStaticDiscoveryRegisterAndWatch(t *testing.T) {
+	d := NewStaticDiscovery()
+
+	ch, err := d.Watch()
+	if err != nil {
+		t.Fatalf("Watch: %s", err)
+	}
+
+	initial := <-ch
+	if len(initial) != 0 {
+		t.Fatalf("expected no peers yet, got %v", initial)
+	}
+
+	if err := d.Register(Peer{ID: "a", AdvertisedRPS: 100}); err != nil {
+		t.Fatalf("Register: %s", err)
+	}
+
+	select {
+	case peers := <-ch:
+		if len(peers) != 1 || peers[0].ID != "a" {
+			t.Fatalf("expected [a], got %v", peers)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for peer registration to be observed")
+	}
+}
+
+func TestStaticDiscoveryDeregister(t *testing.T) {
+	d := NewStaticDiscovery()
+	d.Register(Peer{ID: "a"})
+	d.Register(Peer{ID: "b"})
+
+	if err := d.Deregister("a"); err != nil {
+		t.Fatalf("Deregister: %s", err)
+	}
+
+	ch, _ := d.Watch()
+	peers := <-ch
+	if len(peers) != 1 || peers[0].ID != "b" {
+		t.Fatalf("expected [b], got %v", peers)
+	}
+}
+
+func TestClientSharedRPSErrorsWithNoPeers(t *testing.T) {
+	c := NewClient(Peer{ID: "self"}, NewStaticDiscovery(), time.Hour, nil)
+
+	if _, err := c.SharedRPS(1000); err != ErrNoHealthyPeers {
+		t.Fatalf("expected ErrNoHealthyPeers before any peers are known, got %v", err)
+	}
+}
+
+func TestClientStartDeregistersOnWatchFailure(t *testing.T) {
+	d := &watchFailingDiscovery{}
+	c := NewClient(Peer{ID: "self"}, d, time.Hour, nil)
+
+	if err := c.Start(); err == nil {
+		t.Fatal("expected Start to return the Watch error")
+	}
+
+	if len(d.deregistered) != 1 || d.deregistered[0] != "self" {
+		t.Fatalf("expected self to be deregistered after Watch failed, got %v", d.deregistered)
+	}
+}
+
+func TestClientOnPeersChangedFiresOnStart(t *testing.T) {
+	d := NewStaticDiscovery()
+
+	changed := make(chan []Peer, 1)
+	c := NewClient(Peer{ID: "self", AdvertisedRPS: 100}, d, time.Hour, func(peers []Peer) {
+		changed <- peers
+	})
+
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start: %s", err)
+	}
+	defer c.Stop()
+
+	select {
+	case peers := <-changed:
+		if len(peers) != 1 || peers[0].ID != "self" {
+			t.Fatalf("expected [self], got %v", peers)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for onPeersChanged")
+	}
+
+	rps, err := c.SharedRPS(1000)
+	if err != nil {
+		t.Fatalf("SharedRPS: %s", err)
+	}
+	if rps != 1000 {
+		t.Fatalf("expected 1000 (single peer), got %d", rps)
+	}
+}
@@ -0,0 +1,81 @@
+package hammer
+
+import "sync"
+
+// eventFrame is the shape written to every /events subscriber as a
+// newline-delimited JSON frame.
+type eventFrame struct {
+	Type    string      `json:"type"`
+	Seq     uint64      `json:"seq"`
+	Ts      int64       `json:"ts"`
+	Payload interface{} `json:"payload"`
+}
+
+// subscriberBuffer is how many frames a single /events client can lag behind
+// before the broadcaster starts dropping its oldest unread frames.
+const subscriberBuffer = 256
+
+// broadcaster fans out the log/stats/error channels to any number of
+// subscribers (WebSocket clients) without letting a slow client back-pressure
+// the generator: a full subscriber channel has its oldest frame evicted to
+// make room for the newest one.
+type broadcaster struct {
+	mu          sync.Mutex
+	nextID      uint64
+	seq         uint64
+	subscribers map[uint64]chan eventFrame
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{
+		subscribers: make(map[uint64]chan eventFrame),
+	}
+}
+
+// subscribe registers a new subscriber and returns its channel plus an
+// unsubscribe func that must be called when the client disconnects.
+func (b *broadcaster) subscribe() (<-chan eventFrame, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+
+	ch := make(chan eventFrame, subscriberBuffer)
+	b.subscribers[id] = ch
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if ch, found := b.subscribers[id]; found {
+			delete(b.subscribers, id)
+			close(ch)
+		}
+	}
+}
+
+// publish sends a frame to every current subscriber, dropping that
+// subscriber's oldest buffered frame rather than blocking if it's full.
+func (b *broadcaster) publish(typ string, ts int64, payload interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	frame := eventFrame{Type: typ, Seq: b.seq, Ts: ts, Payload: payload}
+
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- frame:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- frame:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package hammer
+
+import "testing"
+
+func TestBroadcasterPublishDelivers(t *testing.T) {
+	b := newBroadcaster()
+
+	frames, unsubscribe := b.subscribe()
+	defer unsubscribe()
+
+	b.publish("log", 1, "hello")
+
+	frame := <-frames
+	if frame.Type != "log" || frame.Payload != "hello" {
+		t.Fatalf("unexpected frame: %+v", frame)
+	}
+	if frame.Seq != 1 {
+		t.Fatalf("expected seq 1, got %d", frame.Seq)
+	}
+}
+
+func TestBroadcasterDropsOldestWhenFull(t *testing.T) {
+	b := newBroadcaster()
+
+	frames, unsubscribe := b.subscribe()
+	defer unsubscribe()
+
+	// Fill the subscriber's buffer plus one, without ever reading, so the
+	// broadcaster has to evict the oldest frame instead of blocking.
+	for i := 0; i < subscriberBuffer+1; i++ {
+		b.publish("log", int64(i), i)
+	}
+
+	first := <-frames
+	if first.Payload == 0 {
+		t.Fatalf("expected the oldest frame (seq 1) to have been dropped, got payload 0")
+	}
+}
+
+func TestBroadcasterUnsubscribeStopsDelivery(t *testing.T) {
+	b := newBroadcaster()
+
+	frames, unsubscribe := b.subscribe()
+	unsubscribe()
+
+	b.publish("log", 1, "after unsubscribe")
+
+	if _, ok := <-frames; ok {
+		t.Fatalf("expected channel to be closed after unsubscribe")
+	}
+}
+
+func TestBroadcasterMultipleSubscribersEachGetTheFrame(t *testing.T) {
+	b := newBroadcaster()
+
+	framesA, unsubA := b.subscribe()
+	defer unsubA()
+	framesB, unsubB := b.subscribe()
+	defer unsubB()
+
+	b.publish("stat", 1, "x")
+
+	if (<-framesA).Payload != "x" {
+		t.Fatalf("subscriber A did not receive the frame")
+	}
+	if (<-framesB).Payload != "x" {
+		t.Fatalf("subscriber B did not receive the frame")
+	}
+}
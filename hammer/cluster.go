@@ -0,0 +1,157 @@
+package hammer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"dhammer/cluster"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+/*************************
+ * Cluster mode
+ *************************/
+
+// clusterConfigProvider is the optional interface a config.HammerConfig can
+// implement to opt into cluster mode; Init checks for it the same way it
+// checks for ScenarioPath. enabled gates the whole thing off for configs
+// that implement the interface but weren't given cluster settings.
+type clusterConfigProvider interface {
+	ClusterConfig() (self cluster.Peer, discovery cluster.Discovery, heartbeat time.Duration, baseRPS int, enabled bool)
+}
+
+// EnableCluster registers this Hammer with a discovery backend and starts
+// dividing baseRPS across whatever peers that backend reports as healthy,
+// re-adjusting the generator's rate via the same path /update uses whenever
+// peers join or leave. One node in the cluster can additionally drive the
+// others through the /cluster/broadcast API route.
+func (h *Hammer) EnableCluster(self cluster.Peer, discovery cluster.Discovery, heartbeat time.Duration, baseRPS int) error {
+	h.clusterBaseRPS = baseRPS
+	h.clusterClient = cluster.NewClient(self, discovery, heartbeat, h.onClusterPeersChanged)
+
+	return h.clusterClient.Start()
+}
+
+func (h *Hammer) onClusterPeersChanged(peers []cluster.Peer) {
+	if len(peers) == 0 {
+		return
+	}
+
+	rps, err := h.clusterClient.SharedRPS(h.clusterBaseRPS)
+	if err != nil {
+		h.addError(err)
+		return
+	}
+
+	if err := h.generator.Update(map[string]interface{}{"rps": rps}); err != nil {
+		h.addError(err)
+		return
+	}
+
+	h.addLog(fmt.Sprintf("Cluster peers changed (%d healthy); rps adjusted to %d.", len(peers), rps))
+}
+
+func (h *Hammer) clusterPeersHandler(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+	if h.clusterClient == nil {
+		http.Error(response, "cluster mode not enabled", 400)
+		return
+	}
+
+	peers := h.clusterClient.Peers()
+
+	body, err := json.Marshal(peers)
+	if err != nil {
+		h.addError(err)
+		http.Error(response, err.Error(), 500)
+		return
+	}
+
+	response.Write(body)
+}
+
+// rollbackTarget returns the body clusterBroadcastHandler should push to an
+// already-updated peer when a later peer in the same broadcast fails: the
+// previous broadcast's body, or - if this is the first broadcast ever and
+// there is nothing to revert to - that peer's own pre-cluster AdvertisedRPS,
+// so "rollback" is always well defined instead of silently becoming a no-op.
+func rollbackTarget(previous []byte, peer cluster.Peer) ([]byte, error) {
+	if previous != nil {
+		return previous, nil
+	}
+
+	return json.Marshal(map[string]interface{}{"rps": peer.AdvertisedRPS})
+}
+
+func (h *Hammer) clusterBroadcastHandler(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+	if h.clusterClient == nil {
+		http.Error(response, "cluster mode not enabled", 400)
+		return
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		h.addError(err)
+		http.Error(response, err.Error(), 400)
+		return
+	}
+
+	h.clusterMu.Lock()
+	previous := h.clusterLastBroadcast
+	h.clusterMu.Unlock()
+
+	peers := h.clusterClient.Peers()
+	applied := make([]cluster.Peer, 0, len(peers))
+
+	for _, p := range peers {
+		if err := putUpdate(p.APIAddr, body); err != nil {
+			h.addError(err)
+
+			for _, done := range applied {
+				target, targetErr := rollbackTarget(previous, done)
+				if targetErr != nil {
+					h.addError(targetErr)
+					continue
+				}
+
+				if rollbackErr := putUpdate(done.APIAddr, target); rollbackErr != nil {
+					h.addError(rollbackErr)
+				}
+			}
+
+			http.Error(response, fmt.Sprintf("broadcast failed on peer %s: %s", p.ID, err.Error()), 502)
+			return
+		}
+
+		applied = append(applied, p)
+	}
+
+	h.clusterMu.Lock()
+	h.clusterLastBroadcast = body
+	h.clusterMu.Unlock()
+
+	fmt.Fprintf(response, "{\"status\": \"ok\"}")
+}
+
+func putUpdate(apiAddr string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("http://%s/update", apiAddr), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("peer returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
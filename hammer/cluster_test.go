@@ -0,0 +1,37 @@
+package hammer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"dhammer/cluster"
+)
+
+func TestRollbackTargetUsesPreviousSnapshotWhenPresent(t *testing.T) {
+	previous := []byte(`{"rps":42}`)
+
+	target, err := rollbackTarget(previous, cluster.Peer{AdvertisedRPS: 999})
+	if err != nil {
+		t.Fatalf("rollbackTarget: %s", err)
+	}
+
+	if string(target) != string(previous) {
+		t.Fatalf("expected the previous broadcast body, got %s", target)
+	}
+}
+
+func TestRollbackTargetFallsBackToPeerAdvertisedRPSWhenNoPrevious(t *testing.T) {
+	target, err := rollbackTarget(nil, cluster.Peer{AdvertisedRPS: 250})
+	if err != nil {
+		t.Fatalf("rollbackTarget: %s", err)
+	}
+
+	var details map[string]interface{}
+	if err := json.Unmarshal(target, &details); err != nil {
+		t.Fatalf("rollback target isn't valid JSON: %s", err)
+	}
+
+	if details["rps"] != float64(250) {
+		t.Fatalf("expected rps=250, got %v", details["rps"])
+	}
+}
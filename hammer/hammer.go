@@ -1,23 +1,29 @@
 package hammer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"runtime"
 	"sync"
+	"syscall"
 	"time"
 
+	"dhammer/cluster"
 	"dhammer/config"
 	"dhammer/generator"
 	"dhammer/handler"
+	"dhammer/scenario"
 	"dhammer/socketeer"
 	"dhammer/stats"
 
-	"github.com/corneldamian/httpway"
 	"github.com/gorilla/handlers"
+	"github.com/gorilla/websocket"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -26,6 +32,10 @@ import (
 		Option structs should stop being references.
 */
 
+// defaultShutdownGrace is the default for Hammer.ShutdownGrace: how long the
+// API server's graceful Shutdown may take once Run begins shutting down.
+const defaultShutdownGrace = 5 * time.Second
+
 type Hammer struct {
 	options          config.HammerConfig
 	socketeerOptions *config.SocketeerOptions
@@ -38,7 +48,36 @@ type Hammer struct {
 	stats     stats.Stats
 	socketeer *socketeer.RawSocketeer
 
-	apiServer *httpway.Server
+	apiServer *http.Server
+	events    *broadcaster
+
+	// runCtx is the context passed to Run, set before the API server starts
+	// accepting connections. eventsHandler selects on it so a long-lived
+	// /events WebSocket - which http.Server.Shutdown can't close itself -
+	// still gets torn down on a graceful shutdown.
+	runCtx context.Context
+
+	clusterClient        *cluster.Client
+	clusterBaseRPS       int
+	clusterMu            sync.Mutex
+	clusterLastBroadcast []byte
+
+	scenarioMu     sync.Mutex
+	scenarioRunner *scenario.Runner
+
+	observersMu sync.RWMutex
+	observers   []Observer
+
+	// ShutdownGrace bounds how long the API server's graceful Shutdown may
+	// take once Run begins shutting down. The handler, socketeer, and stats
+	// Stop calls that follow are not bounded by it.
+	ShutdownGrace time.Duration
+
+	// Synchronous controls whether Observer callbacks run inline on the
+	// calling goroutine (true) or are spawned in their own goroutine
+	// (false, the default). Inline delivery guarantees ordering at the
+	// cost of letting a slow observer block the caller.
+	Synchronous bool
 }
 
 func New(s *config.SocketeerOptions, o config.HammerConfig) *Hammer {
@@ -49,6 +88,9 @@ func New(s *config.SocketeerOptions, o config.HammerConfig) *Hammer {
 		logChannel:       make(chan string, 1000),
 		statsChannel:     make(chan string, 1000),
 		errorChannel:     make(chan error, 1000),
+		events:           newBroadcaster(),
+		runCtx:           context.Background(),
+		ShutdownGrace:    defaultShutdownGrace,
 	}
 
 	return &h
@@ -91,6 +133,25 @@ func (h *Hammer) Init(apiAddr string, apiPort int) error {
 		return err
 	}
 
+	// config.HammerConfig doesn't carry a --scenario field everywhere it's
+	// embedded, so this is an optional interface rather than a hard
+	// dependency: only configs that expose ScenarioPath() get autoloaded.
+	if sp, ok := h.options.(interface{ ScenarioPath() string }); ok && sp.ScenarioPath() != "" {
+		if err = h.LoadScenario(sp.ScenarioPath()); err != nil {
+			return err
+		}
+	}
+
+	// Same optional-interface story as ScenarioPath: only configs that
+	// expose ClusterConfig() opt into cluster mode.
+	if cp, ok := h.options.(clusterConfigProvider); ok {
+		if self, discovery, heartbeat, baseRPS, enabled := cp.ClusterConfig(); enabled {
+			if err = h.EnableCluster(self, discovery, heartbeat, baseRPS); err != nil {
+				return err
+			}
+		}
+	}
+
 	h.initApiServer(apiAddr, apiPort)
 
 	return nil
@@ -114,8 +175,19 @@ func (h *Hammer) deInit() {
 	if err = h.stats.DeInit(); err != nil {
 		h.addError(err)
 	}
+
+	if h.clusterClient != nil {
+		if err = h.clusterClient.Stop(); err != nil {
+			h.addError(err)
+		}
+	}
 }
-func (h *Hammer) Run() error {
+func (h *Hammer) Run(ctx context.Context) error {
+
+	ctx, stopSignals := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	h.runCtx = ctx
 
 	var wg sync.WaitGroup
 
@@ -126,6 +198,7 @@ func (h *Hammer) Run() error {
 
 		for err = range h.errorChannel {
 			log.Print("ERROR: " + err.Error())
+			h.events.publish("error", time.Now().Unix(), err.Error())
 		}
 		wg.Done()
 		log.Print("INFO: Stopped error channel reader.")
@@ -142,7 +215,7 @@ func (h *Hammer) Run() error {
 	log.Print("INFO: Starting writer.")
 	wg.Add(1)
 	go func() {
-		h.socketeer.RunWriter()
+		h.socketeer.RunWriter(ctx)
 		wg.Done()
 		log.Print("INFO: Stopped writer.")
 	}()
@@ -150,7 +223,7 @@ func (h *Hammer) Run() error {
 	log.Print("INFO: Starting handler.")
 	wg.Add(1)
 	go func() {
-		h.handler.Run()
+		h.handler.Run(ctx)
 		wg.Done()
 		log.Print("INFO: Stopped handler.")
 	}()
@@ -158,7 +231,7 @@ func (h *Hammer) Run() error {
 	log.Print("INFO: Starting listener.")
 	wg.Add(1)
 	go func() {
-		h.socketeer.RunListener()
+		h.socketeer.RunListener(ctx)
 		wg.Done()
 		log.Print("INFO: Stopped listener.")
 	}()
@@ -170,6 +243,7 @@ func (h *Hammer) Run() error {
 
 		for msg = range h.logChannel {
 			log.Print("INFO: " + msg)
+			h.events.publish("log", time.Now().Unix(), msg)
 		}
 		wg.Done()
 		log.Print("INFO: Stopped log channel reader.")
@@ -182,6 +256,7 @@ func (h *Hammer) Run() error {
 
 		for msg = range h.statsChannel {
 			log.Print(msg)
+			h.events.publish("stat", time.Now().Unix(), msg)
 		}
 		wg.Done()
 		log.Print("INFO: Stopped stats channel reader.")
@@ -190,7 +265,7 @@ func (h *Hammer) Run() error {
 	log.Print("INFO: Starting generator.")
 	wg.Add(1)
 	go func() {
-		h.generator.Run()
+		h.generator.Run(ctx)
 		log.Print("INFO: Stopped generator.")
 		log.Print("INFO: Going to stop everything else...")
 		h.stop()
@@ -198,7 +273,7 @@ func (h *Hammer) Run() error {
 	}()
 
 	log.Print("INFO: Starting API server.")
-	h.startApiServer()
+	h.startApiServer(ctx)
 	log.Print("INFO: Stopped API server.")
 
 	wg.Wait()
@@ -206,7 +281,45 @@ func (h *Hammer) Run() error {
 	return nil
 }
 
+// Subscribe registers observer to receive every future log, error, and stat
+// event. Call the returned unsubscribe func when the observer should stop
+// receiving events.
+func (h *Hammer) Subscribe(observer Observer) (unsubscribe func()) {
+	h.observersMu.Lock()
+	h.observers = append(h.observers, observer)
+	h.observersMu.Unlock()
+
+	return func() {
+		h.observersMu.Lock()
+		defer h.observersMu.Unlock()
+
+		for i, o := range h.observers {
+			if o == observer {
+				h.observers = append(h.observers[:i], h.observers[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (h *Hammer) notifyObservers(notify func(Observer)) {
+	h.observersMu.RLock()
+	observers := make([]Observer, len(h.observers))
+	copy(observers, h.observers)
+	h.observersMu.RUnlock()
+
+	for _, o := range observers {
+		if h.Synchronous {
+			notify(o)
+		} else {
+			go notify(o)
+		}
+	}
+}
+
 func (h *Hammer) addError(e error) bool {
+	h.notifyObservers(func(o Observer) { o.OnError(e) })
+
 	select {
 	case h.errorChannel <- e:
 		return true
@@ -216,6 +329,8 @@ func (h *Hammer) addError(e error) bool {
 }
 
 func (h *Hammer) addLog(s string) bool {
+	h.notifyObservers(func(o Observer) { o.OnLog(s) })
+
 	select {
 	case h.logChannel <- s:
 		return true
@@ -226,6 +341,11 @@ func (h *Hammer) addLog(s string) bool {
 }
 
 func (h *Hammer) addStats(s string) bool {
+	for _, stat := range h.stats.Gather() {
+		stat := stat
+		h.notifyObservers(func(o Observer) { o.OnStat(stat) })
+	}
+
 	select {
 	case h.statsChannel <- s:
 		return true
@@ -235,12 +355,10 @@ func (h *Hammer) addStats(s string) bool {
 	return false
 }
 
-func (h *Hammer) Stop() {
+func (h *Hammer) Stop() error {
 	// All "stop" calls should block.
 	// This will make sure no new payloads go TO the writer FROM the generator.
-	if err := h.generator.Stop(); err != nil {
-		panic(err)
-	}
+	return h.generator.Stop()
 }
 
 func (h *Hammer) stop() {
@@ -248,7 +366,10 @@ func (h *Hammer) stop() {
 
 	// All "stop" calls should block.
 
-	if err = h.stopApiServer(); err != nil {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), h.ShutdownGrace)
+	defer cancel()
+
+	if err = h.stopApiServer(shutdownCtx); err != nil {
 		h.addError(err)
 	}
 
@@ -288,6 +409,96 @@ func (h *Hammer) statsHandler(response http.ResponseWriter, request *http.Reques
 	fmt.Fprintf(response, h.stats.String())
 }
 
+func (h *Hammer) metricsHandler(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+	response.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	hammerType := h.options.HammerType()
+
+	for _, s := range h.stats.Gather() {
+		fmt.Fprintf(response, "# HELP dhammer_%s_total Total count of %s observed by dhammer.\n", s.Name, s.Name)
+		fmt.Fprintf(response, "# TYPE dhammer_%s_total counter\n", s.Name)
+		fmt.Fprintf(response, "dhammer_%s_total{hammer=\"%s\"} %d\n", s.Name, hammerType, s.Value)
+
+		fmt.Fprintf(response, "# HELP dhammer_%s_rate Current per-second rate of %s.\n", s.Name, s.Name)
+		fmt.Fprintf(response, "# TYPE dhammer_%s_rate gauge\n", s.Name)
+		fmt.Fprintf(response, "dhammer_%s_rate{hammer=\"%s\"} %f\n", s.Name, hammerType, s.RatePerSecond)
+	}
+
+	fmt.Fprintf(response, "# HELP dhammer_goroutines Number of goroutines currently running.\n")
+	fmt.Fprintf(response, "# TYPE dhammer_goroutines gauge\n")
+	fmt.Fprintf(response, "dhammer_goroutines{hammer=\"%s\"} %d\n", hammerType, runtime.NumGoroutine())
+
+	fmt.Fprintf(response, "# HELP dhammer_open_sockets Number of open file descriptors for this process.\n")
+	fmt.Fprintf(response, "# TYPE dhammer_open_sockets gauge\n")
+	fmt.Fprintf(response, "dhammer_open_sockets{hammer=\"%s\"} %d\n", hammerType, openFileDescriptorCount())
+}
+
+// openFileDescriptorCount returns the number of open file descriptors for
+// this process, or 0 if that information isn't available on this platform.
+func openFileDescriptorCount() int {
+	entries, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0
+	}
+
+	return len(entries)
+}
+
+var eventsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// eventsHandler upgrades to a WebSocket and streams log/stat/error events as
+// newline-delimited JSON frames until the client disconnects. A `type` query
+// parameter ("log", "stat", or "error") restricts the stream to one kind.
+func (h *Hammer) eventsHandler(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+	conn, err := eventsUpgrader.Upgrade(response, request, nil)
+	if err != nil {
+		h.addError(err)
+		return
+	}
+	defer conn.Close()
+
+	typeFilter := request.URL.Query().Get("type")
+
+	frames, unsubscribe := h.events.subscribe()
+	defer unsubscribe()
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case frame, ok := <-frames:
+			if !ok {
+				return
+			}
+			if typeFilter != "" && frame.Type != typeFilter {
+				continue
+			}
+			if err := conn.WriteJSON(frame); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		case <-h.runCtx.Done():
+			// http.Server.Shutdown can't close hijacked connections like
+			// this one, so closing conn here is what makes the reader
+			// goroutine's conn.ReadMessage() return and this handler exit.
+			return
+		}
+	}
+}
+
 func (h *Hammer) updateHandler(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
 
 	body, err := ioutil.ReadAll(request.Body)
@@ -329,25 +540,68 @@ func (h *Hammer) initApiServer(apiAddr string, apiPort int) {
 			h.updateHandler(response, request, ps)
 		})
 
-	h.apiServer = httpway.NewServer(nil)
-	h.apiServer.Handler = handlers.LoggingHandler(os.Stdout, r)
-	h.apiServer.Addr = fmt.Sprintf("%s:%d", apiAddr, apiPort)
-}
+	r.GET("/metrics",
+		func(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+			h.metricsHandler(response, request, ps)
+		})
 
-func (h *Hammer) startApiServer() {
-	if err := h.apiServer.Start(); err != nil {
-		h.addError(err)
-	}
+	r.GET("/events",
+		func(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+			h.eventsHandler(response, request, ps)
+		})
 
-	if err := h.apiServer.WaitStop(2 * time.Second); err != nil {
-		h.addError(err)
+	r.GET("/cluster/peers",
+		func(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+			h.clusterPeersHandler(response, request, ps)
+		})
+
+	r.PUT("/cluster/broadcast",
+		func(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+			h.clusterBroadcastHandler(response, request, ps)
+		})
+
+	r.PUT("/scenario/load",
+		func(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+			h.scenarioLoadHandler(response, request, ps)
+		})
+
+	r.PUT("/scenario/start",
+		func(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+			h.scenarioStartHandler(response, request, ps)
+		})
+
+	r.PUT("/scenario/pause",
+		func(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+			h.scenarioPauseHandler(response, request, ps)
+		})
+
+	r.GET("/scenario/status",
+		func(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+			h.scenarioStatusHandler(response, request, ps)
+		})
+
+	h.apiServer = &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", apiAddr, apiPort),
+		Handler: handlers.LoggingHandler(os.Stdout, r),
 	}
 }
 
-func (h *Hammer) stopApiServer() error {
-	if err := h.apiServer.Stop(); err != nil {
-		return err
+func (h *Hammer) startApiServer(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), h.ShutdownGrace)
+		defer cancel()
+
+		if err := h.stopApiServer(shutdownCtx); err != nil {
+			h.addError(err)
+		}
+	}()
+
+	if err := h.apiServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		h.addError(err)
 	}
+}
 
-	return nil
+func (h *Hammer) stopApiServer(ctx context.Context) error {
+	return h.apiServer.Shutdown(ctx)
 }
@@ -0,0 +1,84 @@
+package hammer
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+
+	"dhammer/stats"
+)
+
+// Observer lets an embedder route dhammer's logs, errors, and stats into its
+// own logging/metrics systems instead of parsing the free-form log.Print
+// output. Register one with Hammer.Subscribe.
+type Observer interface {
+	OnLog(string)
+	OnError(error)
+	OnStat(stats.Stat)
+}
+
+// StdLogObserver forwards events to the standard library logger. Logs and
+// errors use the same "INFO: "/"ERROR: " prefixes as Run's channel readers;
+// stats are written as one "STAT: " line per Stat.
+type StdLogObserver struct{}
+
+func NewStdLogObserver() *StdLogObserver {
+	return &StdLogObserver{}
+}
+
+func (o *StdLogObserver) OnLog(s string) {
+	log.Print("INFO: " + s)
+}
+
+func (o *StdLogObserver) OnError(e error) {
+	log.Print("ERROR: " + e.Error())
+}
+
+func (o *StdLogObserver) OnStat(s stats.Stat) {
+	log.Printf("STAT: %s=%d (%.2f/s)", s.Name, s.Value, s.RatePerSecond)
+}
+
+// jsonEvent is the structured line written by JSONObserver; its fields match
+// what zap/zerolog-style ingestion pipelines expect from a JSON log line.
+type jsonEvent struct {
+	Level   string      `json:"level"`
+	Payload interface{} `json:"payload"`
+}
+
+// JSONObserver writes one structured JSON object per line to w.
+type JSONObserver struct {
+	w io.Writer
+}
+
+func NewJSONObserver(w io.Writer) *JSONObserver {
+	return &JSONObserver{w: w}
+}
+
+func (o *JSONObserver) OnLog(s string) {
+	o.write("info", s)
+}
+
+func (o *JSONObserver) OnError(e error) {
+	o.write("error", e.Error())
+}
+
+func (o *JSONObserver) OnStat(s stats.Stat) {
+	o.write("stat", s)
+}
+
+func (o *JSONObserver) write(level string, payload interface{}) {
+	b, err := json.Marshal(jsonEvent{Level: level, Payload: payload})
+	if err != nil {
+		return
+	}
+
+	o.w.Write(append(b, '\n'))
+}
+
+// NoopObserver discards every event. It's useful in tests that only need to
+// satisfy the Observer interface.
+type NoopObserver struct{}
+
+func (NoopObserver) OnLog(string)      {}
+func (NoopObserver) OnError(error)     {}
+func (NoopObserver) OnStat(stats.Stat) {}
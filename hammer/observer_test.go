@@ -0,0 +1,88 @@
+package hammer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"dhammer/stats"
+)
+
+type recordingObserver struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (r *recordingObserver) OnLog(s string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logs = append(r.logs, s)
+}
+func (r *recordingObserver) OnError(error)     {}
+func (r *recordingObserver) OnStat(stats.Stat) {}
+
+func (r *recordingObserver) snapshot() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]string, len(r.logs))
+	copy(out, r.logs)
+	return out
+}
+
+func TestSubscribeNotifiesObserverSynchronously(t *testing.T) {
+	h := &Hammer{Synchronous: true}
+	obs := &recordingObserver{}
+
+	h.Subscribe(obs)
+	h.notifyObservers(func(o Observer) { o.OnLog("hello") })
+
+	if got := obs.snapshot(); len(got) != 1 || got[0] != "hello" {
+		t.Fatalf("expected [\"hello\"], got %v", got)
+	}
+}
+
+func TestUnsubscribeStopsNotifications(t *testing.T) {
+	h := &Hammer{Synchronous: true}
+	obs := &recordingObserver{}
+
+	unsubscribe := h.Subscribe(obs)
+	unsubscribe()
+	h.notifyObservers(func(o Observer) { o.OnLog("should not arrive") })
+
+	if got := obs.snapshot(); len(got) != 0 {
+		t.Fatalf("expected no notifications after unsubscribe, got %v", got)
+	}
+}
+
+func TestNoopObserverSatisfiesInterface(t *testing.T) {
+	var o Observer = NoopObserver{}
+	o.OnLog("x")
+	o.OnError(errors.New("x"))
+	o.OnStat(stats.Stat{Name: "x"})
+}
+
+func TestJSONObserverWritesOneLinePerEvent(t *testing.T) {
+	var buf bytes.Buffer
+	o := NewJSONObserver(&buf)
+
+	o.OnLog("hello")
+	o.OnStat(stats.Stat{Name: "packets", Value: 5})
+
+	lines := bytes.Split(bytes.TrimRight(buf.Bytes(), "\n"), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 JSON lines, got %d: %s", len(lines), buf.String())
+	}
+
+	var first struct {
+		Level   string `json:"level"`
+		Payload string `json:"payload"`
+	}
+	if err := json.Unmarshal(lines[0], &first); err != nil {
+		t.Fatalf("first line isn't valid JSON: %s", err)
+	}
+	if first.Level != "info" || first.Payload != "hello" {
+		t.Fatalf("unexpected first line: %+v", first)
+	}
+}
@@ -0,0 +1,115 @@
+package hammer
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"dhammer/scenario"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func (h *Hammer) getScenarioRunner() *scenario.Runner {
+	h.scenarioMu.Lock()
+	defer h.scenarioMu.Unlock()
+
+	return h.scenarioRunner
+}
+
+/*************************
+ * Scenario/playbook engine
+ *************************/
+
+// acceptedScenarioKeys are the generator update keys a playbook step is
+// allowed to set. Keep this in sync with what the generator's Update accepts.
+var acceptedScenarioKeys = map[string]bool{
+	"rps":             true,
+	"dhcpMessageType": true,
+}
+
+// LoadScenario loads and validates a playbook from path, making it available
+// to the /scenario/* API routes. It does not start the playbook. Loading a
+// new playbook while one is already running pauses the previous Runner
+// first so it can't keep applying updates in the background.
+func (h *Hammer) LoadScenario(path string) error {
+	pb, err := scenario.Load(path)
+	if err != nil {
+		return err
+	}
+
+	if err := scenario.Validate(pb, acceptedScenarioKeys); err != nil {
+		return err
+	}
+
+	h.scenarioMu.Lock()
+	defer h.scenarioMu.Unlock()
+
+	if h.scenarioRunner != nil {
+		h.scenarioRunner.Pause()
+	}
+
+	h.scenarioRunner = scenario.NewRunner(pb, h.generator.Update, h.addLog)
+
+	return nil
+}
+
+func (h *Hammer) scenarioLoadHandler(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+	path := request.URL.Query().Get("path")
+
+	if err := h.LoadScenario(path); err != nil {
+		h.addError(err)
+		http.Error(response, err.Error(), 400)
+		return
+	}
+
+	response.Write([]byte("{\"status\": \"ok\"}"))
+}
+
+func (h *Hammer) scenarioStartHandler(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+	runner := h.getScenarioRunner()
+	if runner == nil {
+		http.Error(response, "no scenario loaded", 400)
+		return
+	}
+
+	if err := runner.Start(); err != nil {
+		h.addError(err)
+		http.Error(response, err.Error(), 400)
+		return
+	}
+
+	response.Write([]byte("{\"status\": \"ok\"}"))
+}
+
+func (h *Hammer) scenarioPauseHandler(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+	runner := h.getScenarioRunner()
+	if runner == nil {
+		http.Error(response, "no scenario loaded", 400)
+		return
+	}
+
+	if err := runner.Pause(); err != nil {
+		h.addError(err)
+		http.Error(response, err.Error(), 400)
+		return
+	}
+
+	response.Write([]byte("{\"status\": \"ok\"}"))
+}
+
+func (h *Hammer) scenarioStatusHandler(response http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+	runner := h.getScenarioRunner()
+	if runner == nil {
+		http.Error(response, "no scenario loaded", 400)
+		return
+	}
+
+	body, err := json.Marshal(runner.Status())
+	if err != nil {
+		h.addError(err)
+		http.Error(response, err.Error(), 500)
+		return
+	}
+
+	response.Write(body)
+}
@@ -0,0 +1,213 @@
+// Package scenario runs a playbook of timed generator updates, applying each
+// step through the same path the /update API route uses so soak tests,
+// ramps, and message-type transitions can be scripted instead of driven by a
+// shell loop around curl.
+package scenario
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Step is one timed entry in a Playbook: at the given offset from the start
+// of the run, Set is applied via the generator's Update path.
+type Step struct {
+	At  time.Duration          `yaml:"at" json:"at"`
+	Set map[string]interface{} `yaml:"set" json:"set"`
+}
+
+// Playbook is an ordered list of Steps loaded from a YAML or JSON file.
+type Playbook struct {
+	Steps []Step `yaml:"steps" json:"steps"`
+}
+
+// Load reads a playbook from path, choosing a YAML or JSON decoder based on
+// the file extension.
+func Load(path string) (*Playbook, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var pb Playbook
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &pb)
+	default:
+		err = yaml.Unmarshal(data, &pb)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb, nil
+}
+
+// Validate checks every step's Set keys against allowedKeys, the generator's
+// accepted update keys, so a typo in a playbook is caught at load time
+// instead of silently no-opping partway through a run.
+func Validate(pb *Playbook, allowedKeys map[string]bool) error {
+	for i, step := range pb.Steps {
+		for key := range step.Set {
+			if !allowedKeys[key] {
+				return fmt.Errorf("scenario: step %d sets unknown key %q", i, key)
+			}
+		}
+	}
+
+	return nil
+}
+
+// State is the lifecycle of a Runner.
+type State string
+
+const (
+	StateIdle    State = "idle"
+	StateRunning State = "running"
+	StatePaused  State = "paused"
+	StateDone    State = "done"
+)
+
+// Status is a point-in-time snapshot of a Runner, returned by the
+// /scenario/status API route.
+type Status struct {
+	State      State         `json:"state"`
+	NextStep   int           `json:"next_step"`
+	TotalSteps int           `json:"total_steps"`
+	Elapsed    time.Duration `json:"elapsed"`
+}
+
+// Runner applies a Playbook's steps at their scheduled offsets by calling
+// applyFunc, and reports each applied step through logFunc so observers can
+// correlate metric changes to playbook steps.
+type Runner struct {
+	playbook  *Playbook
+	applyFunc func(map[string]interface{}) error
+	logFunc   func(string) bool
+
+	mu        sync.Mutex
+	state     State
+	nextStep  int
+	startedAt time.Time
+	pausedAt  time.Time
+	stopCh    chan struct{}
+}
+
+func NewRunner(pb *Playbook, applyFunc func(map[string]interface{}) error, logFunc func(string) bool) *Runner {
+	return &Runner{
+		playbook:  pb,
+		applyFunc: applyFunc,
+		logFunc:   logFunc,
+		state:     StateIdle,
+	}
+}
+
+// Start begins (or resumes) applying steps in a background goroutine.
+func (r *Runner) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.state == StateRunning {
+		return errors.New("scenario: already running")
+	}
+
+	if r.state == StateDone {
+		return errors.New("scenario: playbook already completed")
+	}
+
+	if r.state == StateIdle {
+		r.startedAt = time.Now()
+	} else if r.state == StatePaused {
+		r.startedAt = r.startedAt.Add(time.Since(r.pausedAt))
+	}
+
+	r.state = StateRunning
+	r.stopCh = make(chan struct{})
+
+	go r.run(r.stopCh)
+
+	return nil
+}
+
+// Pause stops applying further steps until Start is called again.
+func (r *Runner) Pause() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.state != StateRunning {
+		return errors.New("scenario: not running")
+	}
+
+	close(r.stopCh)
+	r.state = StatePaused
+	r.pausedAt = time.Now()
+
+	return nil
+}
+
+// Status returns a snapshot of the Runner's progress.
+func (r *Runner) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var elapsed time.Duration
+	if !r.startedAt.IsZero() {
+		elapsed = time.Since(r.startedAt)
+	}
+
+	return Status{
+		State:      r.state,
+		NextStep:   r.nextStep,
+		TotalSteps: len(r.playbook.Steps),
+		Elapsed:    elapsed,
+	}
+}
+
+func (r *Runner) run(stopCh chan struct{}) {
+	for {
+		r.mu.Lock()
+		if r.nextStep >= len(r.playbook.Steps) {
+			r.state = StateDone
+			r.mu.Unlock()
+			return
+		}
+
+		step := r.playbook.Steps[r.nextStep]
+		wait := step.At - time.Since(r.startedAt)
+		r.mu.Unlock()
+
+		if wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-stopCh:
+				return
+			}
+		} else {
+			select {
+			case <-stopCh:
+				return
+			default:
+			}
+		}
+
+		if err := r.applyFunc(step.Set); err != nil {
+			r.logFunc(fmt.Sprintf("scenario: step %d failed: %s", r.nextStep, err.Error()))
+		} else {
+			r.logFunc(fmt.Sprintf("scenario: step %d applied: %v", r.nextStep, step.Set))
+		}
+
+		r.mu.Lock()
+		r.nextStep++
+		r.mu.Unlock()
+	}
+}
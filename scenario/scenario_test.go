@@ -0,0 +1,111 @@
+package scenario
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestValidateRejectsUnknownKeys(t *testing.T) {
+	pb := &Playbook{Steps: []Step{{At: 0, Set: map[string]interface{}{"bogus": 1}}}}
+
+	if err := Validate(pb, map[string]bool{"rps": true}); err == nil {
+		t.Fatal("expected an error for an unknown update key")
+	}
+}
+
+func TestValidateAcceptsKnownKeys(t *testing.T) {
+	pb := &Playbook{Steps: []Step{{At: 0, Set: map[string]interface{}{"rps": 10}}}}
+
+	if err := Validate(pb, map[string]bool{"rps": true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestRunnerAppliesStepsInOrder(t *testing.T) {
+	pb := &Playbook{Steps: []Step{
+		{At: 0, Set: map[string]interface{}{"rps": 1}},
+		{At: 10 * time.Millisecond, Set: map[string]interface{}{"rps": 2}},
+	}}
+
+	var mu sync.Mutex
+	var applied []interface{}
+
+	r := NewRunner(pb, func(details map[string]interface{}) error {
+		mu.Lock()
+		applied = append(applied, details["rps"])
+		mu.Unlock()
+		return nil
+	}, func(string) bool { return true })
+
+	if err := r.Start(); err != nil {
+		t.Fatalf("Start: %s", err)
+	}
+
+	deadline := time.After(time.Second)
+	for {
+		if r.Status().State == StateDone {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for playbook to finish")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(applied) != 2 || applied[0] != 1 || applied[1] != 2 {
+		t.Fatalf("expected steps applied in order [1 2], got %v", applied)
+	}
+}
+
+func TestRunnerPauseStopsFurtherSteps(t *testing.T) {
+	pb := &Playbook{Steps: []Step{
+		{At: 0, Set: map[string]interface{}{"rps": 1}},
+		{At: time.Hour, Set: map[string]interface{}{"rps": 2}},
+	}}
+
+	var mu sync.Mutex
+	count := 0
+
+	r := NewRunner(pb, func(details map[string]interface{}) error {
+		mu.Lock()
+		count++
+		mu.Unlock()
+		return nil
+	}, func(string) bool { return true })
+
+	if err := r.Start(); err != nil {
+		t.Fatalf("Start: %s", err)
+	}
+
+	// Give the first (At: 0) step time to apply before pausing.
+	time.Sleep(20 * time.Millisecond)
+
+	if err := r.Pause(); err != nil {
+		t.Fatalf("Pause: %s", err)
+	}
+
+	status := r.Status()
+	if status.State != StatePaused {
+		t.Fatalf("expected paused state, got %s", status.State)
+	}
+
+	mu.Lock()
+	got := count
+	mu.Unlock()
+	if got != 1 {
+		t.Fatalf("expected exactly 1 step applied before the hour-long second step, got %d", got)
+	}
+}
+
+func TestRunnerPauseWhenNotRunningErrors(t *testing.T) {
+	pb := &Playbook{Steps: []Step{{At: 0, Set: map[string]interface{}{"rps": 1}}}}
+	r := NewRunner(pb, func(map[string]interface{}) error { return nil }, func(string) bool { return true })
+
+	if err := r.Pause(); err == nil {
+		t.Fatal("expected an error pausing a Runner that was never started")
+	}
+}
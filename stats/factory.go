@@ -19,6 +19,9 @@ type Stats interface {
 	Init() error
 	Run()
 	String() string
+	// Gather returns a snapshot of the current Stat values so callers (e.g. a
+	// Prometheus exporter) can render them without parsing the String() output.
+	Gather() []Stat
 	Stop() error
 	DeInit() error
 }